@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// buildBenchmarkInput generates a synthetic multi-field log stream large enough to make regex evaluation, not
+// I/O, the bottleneck.
+func buildBenchmarkInput(lines int) string {
+	var sb strings.Builder
+	for i := 0; i < lines; i++ {
+		fmt.Fprintf(&sb, "2026-07-27T12:%02d:%02d+00:00 host-%d ip=10.0.%d.%d status=%d bytes=%d user=alice msg=\"request handled\"\n",
+			i%60, (i*7)%60, i%8, i%256, (i*3)%256, 200+(i%5), 512+i)
+	}
+	return sb.String()
+}
+
+// benchmarkPatterns mirrors a realistic multi -r invocation: several independent patterns, each contributing
+// one or two fields, applied to every line.
+func benchmarkPatterns() []*regexp.Regexp {
+	return []*regexp.Regexp{
+		regexp.MustCompile(`^(?P<time_local>\S+) (?P<host>\S+)`),
+		regexp.MustCompile(`ip=(?P<ip>\d+\.\d+\.\d+\.\d+)`),
+		regexp.MustCompile(`status=(?P<status>\d+)`),
+		regexp.MustCompile(`bytes=(?P<bytes>\d+)`),
+		regexp.MustCompile(`user=(?P<user>\w+)`),
+	}
+}
+
+func runProcessLinesBenchmark(b *testing.B, workers int) {
+	input := buildBenchmarkInput(5000)
+	regexes := benchmarkPatterns()
+	opts := processOptions{workers: workers}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		encoder, err := newEncoder("", io.Discard, nil, ",")
+		if err != nil {
+			b.Fatalf("newEncoder: %v", err)
+		}
+		if err := processLines(io.Discard, encoder, strings.NewReader(input), regexes, nil, nil, opts); err != nil {
+			b.Fatalf("processLines: %v", err)
+		}
+	}
+}
+
+// BenchmarkProcessLinesSingleWorker measures throughput with a single worker (-j 1), equivalent to the
+// pre-pipeline single-threaded loop.
+func BenchmarkProcessLinesSingleWorker(b *testing.B) {
+	runProcessLinesBenchmark(b, 1)
+}
+
+// BenchmarkProcessLinesParallel measures throughput with one worker per CPU (-j runtime.NumCPU()) on the same
+// multi-pattern workload, to demonstrate the speedup from parallelizing regex evaluation.
+func BenchmarkProcessLinesParallel(b *testing.B) {
+	runProcessLinesBenchmark(b, runtime.NumCPU())
+}
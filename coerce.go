@@ -0,0 +1,106 @@
+// coerce.go
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FieldSpec describes how a named capture group should be coerced when building the output record. Type
+// selects the target representation: "string" (default), "int", "float", "bool", "duration", or "time:<layout>"
+// where layout is a Go reference-time layout. Default supplies a fallback value used when OnError is
+// "default", and Rename moves the field to a different output key.
+type FieldSpec struct {
+	Type    string `json:"type,omitempty" yaml:"type,omitempty"`
+	Default string `json:"default,omitempty" yaml:"default,omitempty"`
+	Rename  string `json:"rename,omitempty" yaml:"rename,omitempty"`
+	OnError string `json:"on_error,omitempty" yaml:"on_error,omitempty"`
+}
+
+// Recognized FieldSpec.OnError policies. onErrorKeepRaw is applied when OnError is left empty.
+const (
+	onErrorKeepRaw = "keep_raw"
+	onErrorDrop    = "drop"
+	onErrorDefault = "default"
+	onErrorFail    = "fail_record"
+)
+
+// coerceValue converts raw according to spec.Type. An empty or "string" type returns raw unchanged.
+func coerceValue(raw string, spec FieldSpec) (interface{}, error) {
+	switch {
+	case spec.Type == "" || spec.Type == "string":
+		return raw, nil
+	case spec.Type == "int":
+		v, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		return v, nil
+	case spec.Type == "float":
+		v, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return nil, err
+		}
+		return v, nil
+	case spec.Type == "bool":
+		v, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, err
+		}
+		return v, nil
+	case spec.Type == "duration":
+		v, err := time.ParseDuration(raw)
+		if err != nil {
+			return nil, err
+		}
+		return v.String(), nil
+	case strings.HasPrefix(spec.Type, "time:"):
+		t, err := time.Parse(strings.TrimPrefix(spec.Type, "time:"), raw)
+		if err != nil {
+			return nil, err
+		}
+		return t.Format(time.RFC3339), nil
+	default:
+		return nil, fmt.Errorf("unknown field type %q", spec.Type)
+	}
+}
+
+// applyFieldSpec coerces raw using the FieldSpec registered for name, if any. It returns the field name the
+// value should be stored under (honoring Rename), the resulting value, whether the field should be emitted at
+// all, and an error, which is only non-nil when OnError is "fail_record" and coercion failed.
+func applyFieldSpec(name string, raw string, fields map[string]FieldSpec) (string, interface{}, bool, error) {
+	spec, ok := fields[name]
+	if !ok {
+		return name, raw, true, nil
+	}
+
+	outName := name
+	if spec.Rename != "" {
+		outName = spec.Rename
+	}
+
+	value, err := coerceValue(raw, spec)
+	if err == nil {
+		return outName, value, true, nil
+	}
+
+	switch spec.OnError {
+	case onErrorDrop:
+		return outName, nil, false, nil
+	case onErrorDefault:
+		if spec.Default == "" {
+			return outName, nil, false, nil
+		}
+		defaultValue, defaultErr := coerceValue(spec.Default, spec)
+		if defaultErr != nil {
+			return outName, nil, false, nil
+		}
+		return outName, defaultValue, true, nil
+	case onErrorFail:
+		return outName, nil, false, fmt.Errorf("field %q: %w", name, err)
+	default: // "" or onErrorKeepRaw
+		return outName, raw, true, nil
+	}
+}
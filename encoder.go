@@ -0,0 +1,158 @@
+// encoder.go
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Encoder writes the records produced by processLines to the configured output format. WriteRecord is called
+// once per emitted record, in input order; Close is called exactly once, after the last WriteRecord, to let an
+// encoder flush buffered state (e.g. closing a JSON array).
+type Encoder interface {
+	WriteRecord(record map[string]interface{}) error
+	Close() error
+}
+
+// newEncoder builds the Encoder for format. An empty format is equivalent to "ndjson", the tool's original
+// output. fieldOrder gives the fixed column order used by csv/tsv, and listSep is the separator used to
+// flatten slice values for csv/tsv/kv output.
+func newEncoder(format string, writer io.Writer, fieldOrder []string, listSep string) (Encoder, error) {
+	switch format {
+	case "", "ndjson":
+		return &ndjsonEncoder{writer: writer}, nil
+	case "json-array":
+		return &jsonArrayEncoder{writer: writer}, nil
+	case "csv":
+		return newDelimitedEncoder(writer, fieldOrder, ',', listSep)
+	case "tsv":
+		return newDelimitedEncoder(writer, fieldOrder, '\t', listSep)
+	case "kv":
+		return &kvEncoder{writer: writer, listSep: listSep}, nil
+	default:
+		return nil, fmt.Errorf("unknown output format %q", format)
+	}
+}
+
+// ndjsonEncoder writes one JSON object per line, the tool's original output format.
+type ndjsonEncoder struct {
+	writer io.Writer
+}
+
+func (e *ndjsonEncoder) WriteRecord(record map[string]interface{}) error {
+	jsonData, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal record: %w", err)
+	}
+	_, err = fmt.Fprintln(e.writer, string(jsonData))
+	return err
+}
+
+func (e *ndjsonEncoder) Close() error {
+	return nil
+}
+
+// jsonArrayEncoder wraps every record in a single JSON array, deferring the closing bracket until Close.
+type jsonArrayEncoder struct {
+	writer  io.Writer
+	started bool
+}
+
+func (e *jsonArrayEncoder) WriteRecord(record map[string]interface{}) error {
+	jsonData, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal record: %w", err)
+	}
+	prefix := ",\n  "
+	if !e.started {
+		prefix = "[\n  "
+		e.started = true
+	}
+	_, err = fmt.Fprintf(e.writer, "%s%s", prefix, jsonData)
+	return err
+}
+
+func (e *jsonArrayEncoder) Close() error {
+	if !e.started {
+		_, err := fmt.Fprintln(e.writer, "[]")
+		return err
+	}
+	_, err := fmt.Fprint(e.writer, "\n]\n")
+	return err
+}
+
+// delimitedEncoder writes CSV or TSV rows in the fixed field order it is given (main builds it with
+// collectFieldOrder, plus any "_unmatched"/"_lineno" columns), flattening slice values with listSep.
+type delimitedEncoder struct {
+	csvWriter  *csv.Writer
+	fieldOrder []string
+	listSep    string
+}
+
+func newDelimitedEncoder(writer io.Writer, fieldOrder []string, comma rune, listSep string) (*delimitedEncoder, error) {
+	csvWriter := csv.NewWriter(writer)
+	csvWriter.Comma = comma
+	if err := csvWriter.Write(fieldOrder); err != nil {
+		return nil, fmt.Errorf("failed to write header: %w", err)
+	}
+	return &delimitedEncoder{csvWriter: csvWriter, fieldOrder: fieldOrder, listSep: listSep}, nil
+}
+
+func (e *delimitedEncoder) WriteRecord(record map[string]interface{}) error {
+	row := make([]string, len(e.fieldOrder))
+	for i, name := range e.fieldOrder {
+		row[i] = flattenValue(record[name], e.listSep)
+	}
+	return e.csvWriter.Write(row)
+}
+
+func (e *delimitedEncoder) Close() error {
+	e.csvWriter.Flush()
+	return e.csvWriter.Error()
+}
+
+// kvEncoder writes logfmt-style key="value" pairs, one record per line, sorted by key for determinism.
+type kvEncoder struct {
+	writer  io.Writer
+	listSep string
+}
+
+func (e *kvEncoder) WriteRecord(record map[string]interface{}) error {
+	names := make([]string, 0, len(record))
+	for name := range record {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = fmt.Sprintf("%s=%q", name, flattenValue(record[name], e.listSep))
+	}
+	_, err := fmt.Fprintln(e.writer, strings.Join(pairs, " "))
+	return err
+}
+
+func (e *kvEncoder) Close() error {
+	return nil
+}
+
+// flattenValue renders a record value as a single string for formats that have no native array type,
+// joining slice elements with sep.
+func flattenValue(value interface{}, sep string) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case []interface{}:
+		parts := make([]string, len(v))
+		for i, item := range v {
+			parts[i] = fmt.Sprint(item)
+		}
+		return strings.Join(parts, sep)
+	default:
+		return fmt.Sprint(v)
+	}
+}
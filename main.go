@@ -9,7 +9,14 @@ import (
 	"io"
 	"log"
 	"os"
+	"path/filepath"
 	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/magifd2/rex-go/presets"
+	"gopkg.in/yaml.v3"
 )
 
 // stringSlice is a custom type for handling multiple -r flags.
@@ -24,9 +31,11 @@ func (s *stringSlice) Set(value string) error {
 	return nil
 }
 
-// DefinitionFile is the struct for the JSON definition file.
+// DefinitionFile is the struct for the JSON or YAML definition file (selected by the -f file's extension).
+// Fields optionally maps capture-group names to a coercion schema applied when building each output record.
 type DefinitionFile struct {
-	Patterns []string `json:"patterns"`
+	Patterns []string             `json:"patterns" yaml:"patterns"`
+	Fields   map[string]FieldSpec `json:"fields,omitempty" yaml:"fields,omitempty"`
 }
 
 // version is set by the build process using ldflags
@@ -36,10 +45,20 @@ func main() {
 	// --- Define command-line flags ---
 	var regexPatterns stringSlice
 	flag.Var(&regexPatterns, "r", "Regular expression with named capture groups. Can be specified multiple times.")
-	configFile := flag.String("f", "", "Path to a JSON file containing an array of regex patterns.")
+	var presetNames stringSlice
+	flag.Var(&presetNames, "p", "Named log-format preset (e.g. combined, common, syslog3164, syslog5424, apache-error). Can be specified multiple times; composes with -r and -f.")
+	configFile := flag.String("f", "", "Path to a JSON or YAML file containing regex patterns and, optionally, a field coercion schema (YAML is selected by a .yaml/.yml extension).")
 	inputFile := flag.String("i", "", "Input file path (default: stdin).")
 	outputFile := flag.String("o", "", "Output file path (default: stdout).")
 	uniqueValues := flag.Bool("u", false, "Ensure that values for a multi-valued field are unique.")
+	findAllMatches := flag.Bool("a", false, "Extract every match for each regex per line instead of only the first.")
+	recordSeparator := flag.String("R", "", "Regex matching the start of a new record; accumulates multi-line records (e.g. stack traces) instead of reading line by line. Blank lines also end a record.")
+	workers := flag.Int("j", runtime.NumCPU(), "Number of worker goroutines applying regexes concurrently. Output order matches the input regardless of worker count.")
+	invertMatch := flag.Bool("v", false, "Emit only units where no configured regex produced any capture, useful for finding input your patterns don't yet cover.")
+	emitUnmatched := flag.Bool("emit-unmatched", false, "Emit a {\"_unmatched\": \"<raw unit>\", \"_lineno\": N} object for units where no configured regex matched, interleaved with normal results.")
+	lineNumbers := flag.Bool("n", false, "Include the input line number (the record number with -R) as a \"_lineno\" field on every emitted JSON object.")
+	outputFormat := flag.String("F", "", "Output format: ndjson (default), json-array, csv, tsv, or kv.")
+	listSep := flag.String("s", ",", "Separator used to flatten slice values for csv/tsv/kv output.")
 	showVersion := flag.Bool("version", false, "Show version information and exit.")
 
 	// --- Customize help message ---
@@ -56,7 +75,8 @@ func main() {
 		os.Exit(0)
 	}
 
-	// --- Load regex patterns from config file ---
+	// --- Load regex patterns (and field schema) from config file ---
+	fields := make(map[string]FieldSpec)
 	if *configFile != "" {
 		file, err := os.Open(*configFile)
 		if err != nil {
@@ -65,16 +85,34 @@ func main() {
 		defer file.Close()
 
 		var defs DefinitionFile
-		decoder := json.NewDecoder(file)
-		if err := decoder.Decode(&defs); err != nil {
-			log.Fatalf("Error: Could not parse config file %s: %v", *configFile, err)
+		ext := strings.ToLower(filepath.Ext(*configFile))
+		if ext == ".yaml" || ext == ".yml" {
+			if err := yaml.NewDecoder(file).Decode(&defs); err != nil {
+				log.Fatalf("Error: Could not parse config file %s: %v", *configFile, err)
+			}
+		} else {
+			if err := json.NewDecoder(file).Decode(&defs); err != nil {
+				log.Fatalf("Error: Could not parse config file %s: %v", *configFile, err)
+			}
 		}
 		regexPatterns = append(regexPatterns, defs.Patterns...)
+		for name, spec := range defs.Fields {
+			fields[name] = spec
+		}
+	}
+
+	// --- Resolve named presets into patterns ---
+	for _, name := range presetNames {
+		pattern, ok := presets.Lookup(name)
+		if !ok {
+			log.Fatalf("Error: Unknown preset '%s'. Available presets: %s", name, strings.Join(presets.Names(), ", "))
+		}
+		regexPatterns = append(regexPatterns, pattern)
 	}
 
 	// --- Check for required flags ---
 	if len(regexPatterns) == 0 {
-		log.Println("Error: At least one regex pattern must be provided via -r or -f flag.")
+		log.Println("Error: At least one regex pattern must be provided via -r, -f, or -p flag.")
 		flag.Usage()
 		os.Exit(1)
 	}
@@ -92,6 +130,24 @@ func main() {
 		compiledRegexes = append(compiledRegexes, re)
 	}
 
+	// --- Compile the record-boundary regex, if any ---
+	var recordBoundary *regexp.Regexp
+	if *recordSeparator != "" {
+		re, err := regexp.Compile(*recordSeparator)
+		if err != nil {
+			log.Fatalf("Error: Invalid record-separator regular expression '%s': %v", *recordSeparator, err)
+		}
+		recordBoundary = re
+	}
+
+	if *workers < 1 {
+		log.Fatalf("Error: -j must be at least 1, got %d", *workers)
+	}
+
+	if *invertMatch && *outputFormat != "" && *outputFormat != "ndjson" {
+		log.Fatalf("Error: -v writes raw non-matching lines directly to the output stream, which is incompatible with -F %s framing. Use the default ndjson format with -v.", *outputFormat)
+	}
+
 	// --- Set up input source ---
 	var reader io.Reader
 	if *inputFile != "" {
@@ -118,74 +174,371 @@ func main() {
 		writer = os.Stdout
 	}
 
+	// --- Set up the output encoder ---
+	fieldOrder := collectFieldOrder(compiledRegexes, fields)
+	if *emitUnmatched {
+		fieldOrder = append(fieldOrder, "_unmatched")
+	}
+	if *lineNumbers || *emitUnmatched {
+		fieldOrder = append(fieldOrder, "_lineno")
+	}
+	encoder, err := newEncoder(*outputFormat, writer, fieldOrder, *listSep)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
 	// --- Run the main processing logic ---
-	if err := processLines(writer, reader, compiledRegexes, *uniqueValues); err != nil {
+	opts := processOptions{
+		unique:        *uniqueValues,
+		findAll:       *findAllMatches,
+		workers:       *workers,
+		invertMatch:   *invertMatch,
+		emitUnmatched: *emitUnmatched,
+		lineNumbers:   *lineNumbers,
+	}
+	if err := processLines(writer, encoder, reader, compiledRegexes, recordBoundary, fields, opts); err != nil {
 		log.Fatalf("Error during processing: %v", err)
 	}
 }
 
-// processLines reads from the input line by line, applies all regexes to merge results, and outputs as JSON.
-// If the unique flag is true, values in arrays will be unique.
-func processLines(writer io.Writer, reader io.Reader, regexes []*regexp.Regexp, unique bool) error {
-	scanner := bufio.NewScanner(reader)
+// collectFieldOrder returns the union of every regex's named capture groups, in first-appearance order, mapped
+// through fields[name].Rename so the header matches the key buildRecord actually stores the value under. This
+// gives csv/tsv output a stable column order independent of which pattern happens to match a given line.
+func collectFieldOrder(regexes []*regexp.Regexp, fields map[string]FieldSpec) []string {
+	seen := make(map[string]bool)
+	var order []string
+	for _, re := range regexes {
+		for i, name := range re.SubexpNames() {
+			if i == 0 || name == "" {
+				continue
+			}
+			outName := name
+			if spec, ok := fields[name]; ok && spec.Rename != "" {
+				outName = spec.Rename
+			}
+			if seen[outName] {
+				continue
+			}
+			seen[outName] = true
+			order = append(order, outName)
+		}
+	}
+	return order
+}
 
-	for scanner.Scan() {
-		line := scanner.Text()
-		combinedResult := make(map[string]interface{})
+// processOptions bundles the processLines flags that don't change the core regex-matching logic, keeping the
+// function signature from growing a new parameter for every CLI flag.
+type processOptions struct {
+	unique        bool
+	findAll       bool
+	workers       int
+	invertMatch   bool
+	emitUnmatched bool
+	lineNumbers   bool
+}
 
-		for _, re := range regexes {
-			matches := re.FindStringSubmatch(line)
-			if matches == nil {
-				continue
+// job pairs a unit of input with its sequence number, so output order can be restored after concurrent
+// processing even though workers may finish out of order.
+type job struct {
+	seq  int
+	line string
+}
+
+// emission is what a job produces for the writer to emit. raw, if non-nil, is written to the output writer
+// directly, bypassing the Encoder (used for -v's raw passthrough of non-matching lines). Otherwise, if record
+// is non-nil, it is passed to the configured Encoder. If both are nil, nothing is emitted for that unit.
+type emission struct {
+	record map[string]interface{}
+	raw    []byte
+}
+
+// result is a job's output, identified by sequence number so it can be emitted in input order.
+type result struct {
+	seq      int
+	emission *emission
+}
+
+// processLines reads units from the input, applies all regexes to merge results, and writes them through
+// encoder. A unit is normally a single line, but if recordBoundary is non-nil, units are logical records
+// accumulated by readRecords. fields, if non-empty, coerces named captures per FieldSpec before they are merged
+// into the record. See processOptions for the remaining behavior toggles. writer is used only for -v's raw
+// passthrough output, which bypasses encoder entirely.
+//
+// Processing runs as a producer/consumer pipeline: one goroutine reads units into a job channel, opts.workers
+// goroutines apply the regexes concurrently, and this goroutine drains the results and writes them in input
+// order, buffering any that arrive early by sequence number. regexp.Regexp is safe for concurrent use, so the
+// same compiled regexes are shared across all workers.
+func processLines(writer io.Writer, encoder Encoder, reader io.Reader, regexes []*regexp.Regexp, recordBoundary *regexp.Regexp, fields map[string]FieldSpec, opts processOptions) error {
+	units, errc := readRecords(reader, recordBoundary)
+
+	jobs := make(chan job, opts.workers)
+	results := make(chan result, opts.workers)
+
+	go func() {
+		defer close(jobs)
+		seq := 0
+		for line := range units {
+			jobs <- job{seq: seq, line: line}
+			seq++
+		}
+	}()
+
+	var wg sync.WaitGroup
+	wg.Add(opts.workers)
+	for i := 0; i < opts.workers; i++ {
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				results <- result{seq: j.seq, emission: buildRecord(regexes, j.line, fields, opts, j.seq+1)}
 			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
 
-			fieldNames := re.SubexpNames()
-			for i, name := range fieldNames {
-				if i != 0 && name != "" {
-					newValue := matches[i]
-
-					if existingValue, ok := combinedResult[name]; ok {
-						if slice, isSlice := existingValue.([]string); isSlice {
-							shouldAppend := true
-							if unique {
-								for _, v := range slice {
-									if v == newValue {
-										shouldAppend = false
-										break
-									}
-								}
-							}
-							if shouldAppend {
-								combinedResult[name] = append(slice, newValue)
-							}
-						} else {
-							existingString := existingValue.(string)
-							if !unique || existingString != newValue {
-								combinedResult[name] = []string{existingString, newValue}
-							}
-						}
-					} else {
-						combinedResult[name] = newValue
-					}
+	pending := make(map[int]*emission)
+	next := 0
+	for res := range results {
+		pending[res.seq] = res.emission
+		for {
+			e, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			next++
+			switch {
+			case e == nil, e.raw == nil && e.record == nil:
+				continue
+			case e.raw != nil:
+				if _, err := fmt.Fprintln(writer, string(e.raw)); err != nil {
+					return fmt.Errorf("failed to write to output: %w", err)
+				}
+			default:
+				if err := encoder.WriteRecord(e.record); err != nil {
+					return fmt.Errorf("failed to write record: %w", err)
 				}
 			}
 		}
+	}
 
-		if len(combinedResult) > 0 {
-			jsonData, err := json.Marshal(combinedResult)
-			if err != nil {
-				log.Printf("Warning: Could not marshal combined data to JSON for line: %s. Error: %v", line, err)
+	if err := <-errc; err != nil {
+		return err
+	}
+
+	if err := encoder.Close(); err != nil {
+		return fmt.Errorf("failed to finalize output: %w", err)
+	}
+
+	return nil
+}
+
+// buildRecord applies regexes to line and returns what should be emitted for it, or nil to emit nothing. lineNo
+// is the 1-based input line/record number.
+//
+// When no regex matched: opts.invertMatch emits the raw line as-is; otherwise opts.emitUnmatched emits a
+// {"_unmatched": "<raw line>", "_lineno": N} marker record; otherwise nothing is emitted. When a regex did
+// match: opts.invertMatch suppresses output (it only reports non-matching lines); otherwise the combined
+// record is emitted, with "_lineno" added when opts.lineNumbers is set.
+func buildRecord(regexes []*regexp.Regexp, line string, fields map[string]FieldSpec, opts processOptions, lineNo int) *emission {
+	combinedResult := make(map[string]interface{})
+
+	for _, re := range regexes {
+		if err := applyRegex(combinedResult, re, line, opts.findAll, opts.unique, fields); err != nil {
+			log.Printf("Warning: Skipping record due to field coercion error: %v", err)
+			return nil
+		}
+	}
+
+	if len(combinedResult) == 0 {
+		switch {
+		case opts.invertMatch:
+			return &emission{raw: []byte(line)}
+		case opts.emitUnmatched:
+			return &emission{record: map[string]interface{}{"_unmatched": line, "_lineno": lineNo}}
+		default:
+			return nil
+		}
+	}
+
+	if opts.invertMatch {
+		return nil
+	}
+
+	if opts.lineNumbers {
+		combinedResult["_lineno"] = lineNo
+	}
+
+	return &emission{record: combinedResult}
+}
+
+// applyRegex runs re against line (in find-all or find-first mode per findAll), coerces each captured value
+// through fields, and merges the surviving values into combinedResult. It returns a non-nil error only when a
+// field's on_error policy is "fail_record", in which case the whole record should be discarded.
+func applyRegex(combinedResult map[string]interface{}, re *regexp.Regexp, line string, findAll bool, unique bool, fields map[string]FieldSpec) error {
+	fieldNames := re.SubexpNames()
+
+	if findAll {
+		allMatches := re.FindAllStringSubmatch(line, -1)
+		if allMatches == nil {
+			return nil
+		}
+		for i, name := range fieldNames {
+			if i == 0 || name == "" {
 				continue
 			}
-			if _, err := fmt.Fprintln(writer, string(jsonData)); err != nil {
-				return fmt.Errorf("failed to write to output: %w", err)
+			raw := make([]string, 0, len(allMatches))
+			for _, matches := range allMatches {
+				raw = append(raw, matches[i])
+			}
+			if err := mergeCapturedValues(combinedResult, name, raw, unique, true, fields); err != nil {
+				return err
 			}
 		}
+		return nil
 	}
 
-	if err := scanner.Err(); err != nil {
-		return fmt.Errorf("error reading from input: %w", err)
+	matches := re.FindStringSubmatch(line)
+	if matches == nil {
+		return nil
+	}
+	for i, name := range fieldNames {
+		if i == 0 || name == "" {
+			continue
+		}
+		if err := mergeCapturedValues(combinedResult, name, []string{matches[i]}, unique, false, fields); err != nil {
+			return err
+		}
 	}
+	return nil
+}
 
+// mergeCapturedValues coerces each raw capture for name through fields, then merges the surviving values into
+// combinedResult via mergeField. A capture dropped by its FieldSpec's on_error policy is simply omitted.
+func mergeCapturedValues(combinedResult map[string]interface{}, name string, raw []string, unique bool, forceSlice bool, fields map[string]FieldSpec) error {
+	outName := name
+	values := make([]interface{}, 0, len(raw))
+	for _, r := range raw {
+		resolvedName, value, keep, err := applyFieldSpec(name, r, fields)
+		if err != nil {
+			return err
+		}
+		outName = resolvedName
+		if !keep {
+			continue
+		}
+		values = append(values, value)
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	mergeField(combinedResult, outName, values, unique, forceSlice)
 	return nil
 }
+
+// readRecords reads units from r and streams them on the returned channel. If boundary is nil, each unit is a
+// single line, equivalent to the previous line-by-line behavior. If boundary is set, r is read with a
+// bufio.Reader (no 64KB line-length limit) and lines are accumulated into a record until either a blank line is
+// seen or a later line's prefix matches boundary, mirroring how log-parsing tools group multi-line events (e.g.
+// Java stack traces starting with a timestamp) into a single record for regex application.
+func readRecords(r io.Reader, boundary *regexp.Regexp) (<-chan string, <-chan error) {
+	out := make(chan string)
+	errc := make(chan error, 1)
+
+	go func() {
+		defer close(out)
+		defer close(errc)
+
+		if boundary == nil {
+			scanner := bufio.NewScanner(r)
+			for scanner.Scan() {
+				out <- scanner.Text()
+			}
+			if err := scanner.Err(); err != nil {
+				errc <- fmt.Errorf("error reading from input: %w", err)
+			}
+			return
+		}
+
+		bufReader := bufio.NewReader(r)
+		var record []string
+		flush := func() {
+			if len(record) > 0 {
+				out <- strings.Join(record, "\n")
+				record = nil
+			}
+		}
+
+		for {
+			line, err := bufReader.ReadString('\n')
+			line = strings.TrimSuffix(line, "\n")
+			line = strings.TrimSuffix(line, "\r")
+
+			if line == "" {
+				flush()
+			} else {
+				if loc := boundary.FindStringIndex(line); loc != nil && loc[0] == 0 && len(record) > 0 {
+					flush()
+				}
+				record = append(record, line)
+			}
+
+			if err != nil {
+				if err != io.EOF {
+					errc <- fmt.Errorf("error reading from input: %w", err)
+					return
+				}
+				flush()
+				return
+			}
+		}
+	}()
+
+	return out, errc
+}
+
+// mergeField merges newValues into combinedResult under name, promoting the field to a []interface{} as soon as
+// more than one value is present for it. forceSlice keeps the field as a []interface{} even for a single value,
+// which is used by find-all mode so that a field populated by FindAllStringSubmatch is always a JSON array.
+// If unique is true, values already present for the field are not appended again.
+func mergeField(combinedResult map[string]interface{}, name string, newValues []interface{}, unique bool, forceSlice bool) {
+	existingValue, ok := combinedResult[name]
+	if !ok {
+		if !forceSlice && len(newValues) == 1 {
+			combinedResult[name] = newValues[0]
+			return
+		}
+		combinedResult[name] = appendValues(nil, newValues, unique)
+		return
+	}
+
+	switch existing := existingValue.(type) {
+	case []interface{}:
+		combinedResult[name] = appendValues(existing, newValues, unique)
+	default:
+		combinedResult[name] = appendValues([]interface{}{existing}, newValues, unique)
+	}
+}
+
+// appendValues appends newValues to base, skipping values already present in base when unique is true.
+func appendValues(base []interface{}, newValues []interface{}, unique bool) []interface{} {
+	result := base
+	for _, v := range newValues {
+		if unique {
+			alreadyPresent := false
+			for _, existing := range result {
+				if existing == v {
+					alreadyPresent = true
+					break
+				}
+			}
+			if alreadyPresent {
+				continue
+			}
+		}
+		result = append(result, v)
+	}
+	return result
+}
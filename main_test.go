@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+// TestApplyRegexFindAllAndSingleMatchMergeSameField exercises the overlap called out by the -a request: a
+// single-match regex and a find-all regex both capturing the same field name must merge through the same
+// append-or-promote path in mergeField, regardless of which mode produced which value.
+func TestApplyRegexFindAllAndSingleMatchMergeSameField(t *testing.T) {
+	single := regexp.MustCompile(`^(?P<ip>\d+\.\d+\.\d+\.\d+)`)
+	all := regexp.MustCompile(`(?P<ip>\d+\.\d+\.\d+\.\d+)`)
+	line := "10.0.0.1 talked to 10.0.0.2 and 10.0.0.1 again"
+
+	combinedResult := make(map[string]interface{})
+	if err := applyRegex(combinedResult, single, line, false, false, nil); err != nil {
+		t.Fatalf("applyRegex (single-match) returned error: %v", err)
+	}
+	if err := applyRegex(combinedResult, all, line, true, false, nil); err != nil {
+		t.Fatalf("applyRegex (find-all) returned error: %v", err)
+	}
+
+	got, ok := combinedResult["ip"].([]interface{})
+	if !ok {
+		t.Fatalf("expected ip field to be a slice, got %T: %v", combinedResult["ip"], combinedResult["ip"])
+	}
+	want := []interface{}{"10.0.0.1", "10.0.0.1", "10.0.0.2", "10.0.0.1"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ip = %v, want %v", got, want)
+	}
+}
+
+// TestApplyRegexFindAllAndSingleMatchMergeSameFieldUnique is the same overlap as above with -u set, which
+// should dedupe across both the single-match and find-all contributions.
+func TestApplyRegexFindAllAndSingleMatchMergeSameFieldUnique(t *testing.T) {
+	single := regexp.MustCompile(`^(?P<ip>\d+\.\d+\.\d+\.\d+)`)
+	all := regexp.MustCompile(`(?P<ip>\d+\.\d+\.\d+\.\d+)`)
+	line := "10.0.0.1 talked to 10.0.0.2 and 10.0.0.1 again"
+
+	combinedResult := make(map[string]interface{})
+	if err := applyRegex(combinedResult, single, line, false, true, nil); err != nil {
+		t.Fatalf("applyRegex (single-match) returned error: %v", err)
+	}
+	if err := applyRegex(combinedResult, all, line, true, true, nil); err != nil {
+		t.Fatalf("applyRegex (find-all) returned error: %v", err)
+	}
+
+	got, ok := combinedResult["ip"].([]interface{})
+	if !ok {
+		t.Fatalf("expected ip field to be a slice, got %T: %v", combinedResult["ip"], combinedResult["ip"])
+	}
+	want := []interface{}{"10.0.0.1", "10.0.0.2"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ip = %v, want %v", got, want)
+	}
+}
+
+// TestMergeFieldForceSliceSingleValue checks that find-all mode's forceSlice keeps a field that matched only
+// once as a JSON array, as opposed to single-match mode which stores a bare scalar.
+func TestMergeFieldForceSliceSingleValue(t *testing.T) {
+	combinedResult := make(map[string]interface{})
+	mergeField(combinedResult, "status", []interface{}{"200"}, false, true)
+
+	got, ok := combinedResult["status"].([]interface{})
+	if !ok {
+		t.Fatalf("expected status to be []interface{}, got %T", combinedResult["status"])
+	}
+	want := []interface{}{"200"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("status = %v, want %v", got, want)
+	}
+}
+
+// TestMergeFieldSingleMatchKeepsScalar is the single-match counterpart: a lone value with forceSlice=false
+// stays a bare string until a second value arrives.
+func TestMergeFieldSingleMatchKeepsScalar(t *testing.T) {
+	combinedResult := make(map[string]interface{})
+	mergeField(combinedResult, "status", []interface{}{"200"}, false, false)
+
+	got, ok := combinedResult["status"].(string)
+	if !ok {
+		t.Fatalf("expected status to be a string, got %T", combinedResult["status"])
+	}
+	if got != "200" {
+		t.Errorf("status = %q, want %q", got, "200")
+	}
+}
+
+// TestCollectFieldOrderHonorsRename covers the csv/tsv header bug: a field renamed by a FieldSpec must appear
+// in fieldOrder under its renamed key, not its captured name, since that's the key buildRecord stores the
+// value under.
+func TestCollectFieldOrderHonorsRename(t *testing.T) {
+	re := regexp.MustCompile(`status=(?P<status>\d+) user=(?P<user>\w+)`)
+	fields := map[string]FieldSpec{
+		"status": {Rename: "code"},
+	}
+
+	got := collectFieldOrder([]*regexp.Regexp{re}, fields)
+	want := []string{"code", "user"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("collectFieldOrder = %v, want %v", got, want)
+	}
+}
+
+// TestDelimitedEncoderWritesRenamedField is an end-to-end check that a csv row actually carries the renamed
+// field's value under the renamed header, rather than a blank column for the original name.
+func TestDelimitedEncoderWritesRenamedField(t *testing.T) {
+	var buf bytes.Buffer
+	encoder, err := newDelimitedEncoder(&buf, []string{"code", "user"}, ',', ",")
+	if err != nil {
+		t.Fatalf("newDelimitedEncoder returned error: %v", err)
+	}
+	if err := encoder.WriteRecord(map[string]interface{}{"code": "200", "user": "alice"}); err != nil {
+		t.Fatalf("WriteRecord returned error: %v", err)
+	}
+	if err := encoder.Close(); err != nil {
+		t.Fatalf("Close returned error: %v", err)
+	}
+
+	want := "code,user\n200,alice\n"
+	if buf.String() != want {
+		t.Errorf("csv output = %q, want %q", buf.String(), want)
+	}
+}
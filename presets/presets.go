@@ -0,0 +1,51 @@
+// Package presets holds curated, named regular expressions for popular log formats, so users don't have to
+// hand-write patterns for well-known layouts. Each preset exposes a ready-made pattern with named capture
+// groups matching the field names commonly used across the log-parsing ecosystem.
+package presets
+
+import "sort"
+
+// registry maps a preset name (as passed to the -p flag) to its pattern. Third parties extending rex-go can
+// add further entries here.
+var registry = map[string]string{
+	"common":       commonLogPattern,
+	"combined":     combinedLogPattern,
+	"syslog3164":   syslog3164Pattern,
+	"syslog5424":   syslog5424Pattern,
+	"apache-error": apacheErrorPattern,
+}
+
+// NCSA Common Log Format, e.g.:
+// 127.0.0.1 - frank [10/Oct/2023:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326
+const commonLogPattern = `^(?P<remote_addr>\S+) (?P<ident>\S+) (?P<remote_user>\S+) \[(?P<time_local>[^\]]+)\] "(?P<request>[^"]*)" (?P<status>\d{3}) (?P<body_bytes_sent>\S+)$`
+
+// NGINX/Apache combined log format: Common Log Format plus referer and user agent.
+const combinedLogPattern = `^(?P<remote_addr>\S+) (?P<ident>\S+) (?P<remote_user>\S+) \[(?P<time_local>[^\]]+)\] "(?P<request>[^"]*)" (?P<status>\d{3}) (?P<body_bytes_sent>\S+) "(?P<http_referer>[^"]*)" "(?P<http_user_agent>[^"]*)"$`
+
+// RFC 3164 syslog, e.g.:
+// <34>Oct 11 22:14:15 mymachine su: 'su root' failed for lonvick on /dev/pts/8
+const syslog3164Pattern = `^<(?P<pri>\d+)>(?P<time_local>\w{3}\s+\d{1,2}\s\d{2}:\d{2}:\d{2}) (?P<hostname>\S+) (?P<tag>[^:\[]+)(?:\[(?P<pid>\d+)\])?: (?P<message>.*)$`
+
+// RFC 5424 syslog, e.g.:
+// <34>1 2023-10-11T22:14:15.003Z mymachine.example.com su - ID47 - 'su root' failed for lonvick
+const syslog5424Pattern = `^<(?P<pri>\d+)>(?P<version>\d+) (?P<time_local>\S+) (?P<hostname>\S+) (?P<app_name>\S+) (?P<procid>\S+) (?P<msgid>\S+) (?P<structured_data>(?:-|\[.*\])) (?P<message>.*)$`
+
+// Apache/httpd error log, e.g.:
+// [Wed Oct 11 14:32:52 2023] [error] [client 127.0.0.1] File does not exist: /var/www/favicon.ico
+const apacheErrorPattern = `^\[(?P<time_local>[^\]]+)\] \[(?P<level>[^\]]+)\](?: \[client (?P<remote_addr>[^\]]+)\])? (?P<message>.*)$`
+
+// Lookup returns the pattern registered under name, and whether it was found.
+func Lookup(name string) (string, bool) {
+	pattern, ok := registry[name]
+	return pattern, ok
+}
+
+// Names returns the registered preset names in sorted order, for use in help text and error messages.
+func Names() []string {
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}